@@ -5,6 +5,9 @@ package main
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -16,6 +19,7 @@ import (
 
 	"github.com/romana/rlog"
 	"github.com/xlzd/gotp"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/scrypt"
 	"golang.org/x/term"
 )
@@ -24,23 +28,40 @@ const (
 	aegisKeyLen = 32
 )
 
+// Aegis key slot KDFs. Password slots (type 1) derive the master key
+// wrapping key with either scrypt (the historical default) or Argon2id
+// (the default in newer Aegis versions), distinguished by which set of
+// KDF parameters the slot carries.
+const (
+	aegisSlotTypePassword = 1
+)
+
+// aegisSlot represents a single master key slot in an Aegis encrypted
+// export. Password slots (Type == aegisSlotTypePassword) carry either
+// scrypt (N, R, P) or Argon2id (Mem, Time, P) parameters, never both.
+type aegisSlot struct {
+	Type      int    `json:"type"`
+	UUID      string `json:"uuid"`
+	Key       string `json:"key"`
+	KeyParams struct {
+		Nonce string `json:"nonce"`
+		Tag   string `json:"tag"`
+	} `json:"key_params"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+	// Argon2id parameters, present instead of N/R when the slot was
+	// protected with Argon2id rather than scrypt.
+	Mem  int `json:"mem"`
+	Time int `json:"t"`
+}
+
 // aegisEncryptedJSON represents an encrypted Aegis JSON export file.
 type aegisEncryptedJSON struct {
 	Version int `json:"version"`
 	Header  struct {
-		Slots []struct {
-			Type      int    `json:"type"`
-			UUID      string `json:"uuid"`
-			Key       string `json:"key"`
-			KeyParams struct {
-				Nonce string `json:"nonce"`
-				Tag   string `json:"tag"`
-			} `json:"key_params"`
-			N    int    `json:"n"`
-			R    int    `json:"r"`
-			P    int    `json:"p"`
-			Salt string `json:"salt"`
-		} `json:"slots"`
+		Slots  []aegisSlot `json:"slots"`
 		Params struct {
 			Nonce string `json:"nonce"`
 			Tag   string `json:"tag"`
@@ -49,21 +70,26 @@ type aegisEncryptedJSON struct {
 	Db string `json:"db"`
 }
 
+// aegisEntry represents a single entry in a plain Aegis JSON export.
+type aegisEntry struct {
+	Type   string `json:"type"`
+	UUID   string `json:"uuid"`
+	Name   string `json:"name"`
+	Issuer string `json:"issuer"`
+	Icon   string `json:"icon"`
+	Info   struct {
+		Secret  string `json:"secret"`
+		Digits  int    `json:"digits"`
+		Algo    string `json:"algo"`
+		Period  int    `json:"period"`
+		Counter int    `json:"counter"`
+	} `json:"info"`
+}
+
 // aegisJSON represents a plain Aegis JSON export file.
 type aegisJSON struct {
-	Version int `json:"version"`
-	Entries []struct {
-		Type   string `json:"type"`
-		Name   string `json:"name"`
-		Issuer string `json:"issuer"`
-		Icon   string `json:"icon"`
-		Info   struct {
-			Secret string `json:"secret"`
-			Digits int    `json:"digits"`
-			Algo   string `json:"algo"`
-			Period int    `json:"period"`
-		} `json:"info"`
-	}
+	Version int          `json:"version"`
+	Entries []aegisEntry `json:"entries"`
 }
 
 // newAES creates a new AESGCM cipher.
@@ -80,11 +106,59 @@ func newAES(key []byte) (cipher.AEAD, error) {
 	return aesgcm, nil
 }
 
+// totpHasher returns the gotp.Hasher for algo, Aegis's HMAC algorithm
+// name for a TOTP entry ("SHA1", "SHA256" or "SHA512", matched
+// case-insensitively). An empty or unrecognized algo falls back to
+// gotp's own SHA1 default (nil is valid input to gotp.NewTOTP).
+func totpHasher(algo string) *gotp.Hasher {
+	switch strings.ToUpper(algo) {
+	case "SHA256":
+		return &gotp.Hasher{HashName: "sha256", Digest: sha256.New}
+	case "SHA512":
+		return &gotp.Hasher{HashName: "sha512", Digest: sha512.New}
+	default:
+		return nil
+	}
+}
+
 // readPassword reads the user password from the terminal.  If the input is a
 // terminal, it uses terminal specific codes to turn off typing echo. If the
 // input is not a terminal, it assumes we can read the password directly from
 // it (E.g, when redirecting from a process or a file.)
 func readPassword() ([]byte, error) {
+	return readPasswordPrompt("Enter password: ")
+}
+
+// readPasswordConfirmed reads a password like readPassword, then asks for
+// it a second time and returns an error if the two don't match. When
+// stdin isn't a terminal there's nothing sensible to confirm against
+// (there's only one line to read), so it falls back to readPassword.
+func readPasswordConfirmed() ([]byte, error) {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if (fi.Mode() & os.ModeCharDevice) == 0 {
+		return readPassword()
+	}
+
+	password, err := readPasswordPrompt("Enter password: ")
+	if err != nil {
+		return nil, err
+	}
+	confirm, err := readPasswordPrompt("Re-enter password: ")
+	if err != nil {
+		return nil, err
+	}
+	if string(password) != string(confirm) {
+		return nil, errors.New("passwords do not match")
+	}
+	return password, nil
+}
+
+// readPasswordPrompt reads a single password from the terminal (or
+// stdin, if it's not a terminal), using prompt as the terminal prompt.
+func readPasswordPrompt(prompt string) ([]byte, error) {
 	fi, err := os.Stdin.Stat()
 	if err != nil {
 		return nil, err
@@ -102,7 +176,7 @@ func readPassword() ([]byte, error) {
 		defer term.Restore(int(os.Stdin.Fd()), savedState)
 
 		terminal := term.NewTerminal(os.Stdin, ">")
-		password, err = terminal.ReadPassword("Enter password: ")
+		password, err = terminal.ReadPassword(prompt)
 		if err != nil {
 			return nil, err
 		}
@@ -119,8 +193,12 @@ func readPassword() ([]byte, error) {
 
 // filterAegisVault filters an Aegis plain JSON into our internal
 // representation of the vault, using "rematch" as a regular expression to
-// match the issuer or account.
-func filterAegisVault(plainJSON []byte, rematch *regexp.Regexp) ([]otpEntry, error) {
+// match the issuer or account. Entries that don't match are skipped
+// before any token is computed, so a non-matching HOTP entry never
+// advances (and persists) its counter. counterPath is the sidecar file
+// used to persist HOTP counters across invocations (see
+// hotpcounter.go); it's only touched for entries of type "hotp".
+func filterAegisVault(plainJSON []byte, rematch *regexp.Regexp, counterPath string) ([]otpEntry, error) {
 	vault := &aegisJSON{}
 	if err := json.Unmarshal(plainJSON, &vault); err != nil {
 		return nil, err
@@ -129,17 +207,66 @@ func filterAegisVault(plainJSON []byte, rematch *regexp.Regexp) ([]otpEntry, err
 	ret := []otpEntry{}
 
 	for _, entry := range vault.Entries {
-		token := "Unknown OTP type: " + entry.Type
-		if entry.Type == "totp" {
-			token = gotp.NewDefaultTOTP(entry.Info.Secret).Now()
+		if !rematch.MatchString(entry.Issuer) && !rematch.MatchString(entry.Name) {
+			continue
 		}
-		if rematch.MatchString(entry.Issuer) || rematch.MatchString(entry.Name) {
-			ret = append(ret, otpEntry{
-				Issuer:  entry.Issuer,
-				Account: entry.Name,
-				Token:   token,
-			})
+
+		var (
+			token   string
+			secret  string
+			digits  int
+			counter int
+			period  int
+			algo    string
+			err     error
+		)
+
+		switch entry.Type {
+		case "totp":
+			secret = entry.Info.Secret
+			digits = entry.Info.Digits
+			if digits == 0 {
+				digits = 6
+			}
+			period = entry.Info.Period
+			if period == 0 {
+				period = 30
+			}
+			algo = entry.Info.Algo
+			token = gotp.NewTOTP(secret, digits, period, totpHasher(algo)).Now()
+		case "hotp":
+			secret = entry.Info.Secret
+			digits = entry.Info.Digits
+			if digits == 0 {
+				digits = 6
+			}
+			key := hotpCounterKey(entry.Issuer, entry.Name, entry.UUID)
+			counter, err = loadAndAdvanceHOTPCounter(counterPath, key, entry.Info.Counter)
+			if err != nil {
+				return nil, fmt.Errorf("hotp counter for %s: %v", key, err)
+			}
+			token = gotp.NewHOTP(secret, digits, nil).At(counter)
+		case "steam":
+			secret = entry.Info.Secret
+			token, err = steamToken(secret)
+			if err != nil {
+				return nil, fmt.Errorf("steam token: %v", err)
+			}
+		default:
+			token = "Unknown OTP type: " + entry.Type
 		}
+
+		ret = append(ret, otpEntry{
+			Issuer:  entry.Issuer,
+			Account: entry.Name,
+			Token:   token,
+			Type:    entry.Type,
+			secret:  secret,
+			digits:  digits,
+			counter: counter,
+			period:  period,
+			algo:    algo,
+		})
 	}
 	return ret, nil
 }
@@ -168,16 +295,22 @@ func aegisDecrypt(fname string, password []byte) ([]byte, error) {
 			salt    []byte
 		)
 
-		if slot.Type != 1 {
+		if slot.Type != aegisSlotTypePassword {
 			continue
 		}
 		if salt, err = hex.DecodeString(slot.Salt); err != nil {
 			return nil, fmt.Errorf("slot salt: %v", err)
 		}
 
-		key, err := scrypt.Key(password, salt, slot.N, slot.R, slot.P, aegisKeyLen)
-		if err != nil {
-			return nil, err
+		var key []byte
+		if slot.Mem > 0 {
+			// Argon2id slot.
+			key = argon2.IDKey(password, salt, uint32(slot.Time), uint32(slot.Mem), uint8(slot.P), aegisKeyLen)
+		} else {
+			// scrypt slot.
+			if key, err = scrypt.Key(password, salt, slot.N, slot.R, slot.P, aegisKeyLen); err != nil {
+				return nil, err
+			}
 		}
 
 		// AES GCM decrypt.
@@ -245,3 +378,140 @@ func aegisDecrypt(fname string, password []byte) ([]byte, error) {
 
 	return db, nil
 }
+
+// KDFParams selects the key derivation function (and its parameters)
+// used to wrap the master key in a new password slot.
+type KDFParams struct {
+	// KDF is "scrypt" or "argon2id". Defaults to scrypt if empty.
+	KDF string
+
+	// scrypt parameters.
+	N, R, P int
+
+	// Argon2id parameters (P above is reused as parallelism).
+	Mem, Time int
+}
+
+// DefaultScryptParams returns the scrypt parameters Aegis itself uses
+// for newly created password slots.
+func DefaultScryptParams() KDFParams {
+	return KDFParams{KDF: "scrypt", N: 1 << 15, R: 8, P: 1}
+}
+
+// aegisEncrypt marshals entries into a plain Aegis JSON vault, then
+// encrypts it the way Aegis does: a random master key wraps the vault
+// under AES-GCM, and the master key itself is wrapped in a single
+// password slot derived from password using params.
+func aegisEncrypt(entries []otpEntry, password []byte, params KDFParams) ([]byte, error) {
+	masterkey := make([]byte, aegisKeyLen)
+	if _, err := rand.Read(masterkey); err != nil {
+		return nil, err
+	}
+
+	plainDB, err := json.Marshal(aegisJSON{
+		Version: 2,
+		Entries: otpEntriesToAegis(entries),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slot, slotKey, err := newAegisSlot(password, params)
+	if err != nil {
+		return nil, err
+	}
+
+	slotAesgcm, err := newAES(slotKey)
+	if err != nil {
+		return nil, err
+	}
+	slotNonce := make([]byte, 12)
+	if _, err := rand.Read(slotNonce); err != nil {
+		return nil, err
+	}
+	sealedKey := slotAesgcm.Seal(nil, slotNonce, masterkey, nil)
+	slot.Key = hex.EncodeToString(sealedKey[:len(sealedKey)-16])
+	slot.KeyParams.Tag = hex.EncodeToString(sealedKey[len(sealedKey)-16:])
+	slot.KeyParams.Nonce = hex.EncodeToString(slotNonce)
+
+	dbAesgcm, err := newAES(masterkey)
+	if err != nil {
+		return nil, err
+	}
+	dbNonce := make([]byte, 12)
+	if _, err := rand.Read(dbNonce); err != nil {
+		return nil, err
+	}
+	sealedDB := dbAesgcm.Seal(nil, dbNonce, plainDB, nil)
+
+	enc := aegisEncryptedJSON{Version: 1}
+	enc.Header.Slots = []aegisSlot{slot}
+	enc.Header.Params.Nonce = hex.EncodeToString(dbNonce)
+	enc.Header.Params.Tag = hex.EncodeToString(sealedDB[len(sealedDB)-16:])
+	enc.Db = base64.StdEncoding.EncodeToString(sealedDB[:len(sealedDB)-16])
+
+	return json.Marshal(enc)
+}
+
+// newAegisSlot derives a password slot key from password using params,
+// returning the (still key-less) slot and the derived slot key.
+func newAegisSlot(password []byte, params KDFParams) (aegisSlot, []byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return aegisSlot{}, nil, err
+	}
+	slot := aegisSlot{Type: aegisSlotTypePassword, Salt: hex.EncodeToString(salt)}
+
+	if params.KDF == "argon2id" {
+		slot.Mem, slot.Time, slot.P = params.Mem, params.Time, params.P
+		key := argon2.IDKey(password, salt, uint32(slot.Time), uint32(slot.Mem), uint8(slot.P), aegisKeyLen)
+		return slot, key, nil
+	}
+
+	slot.N, slot.R, slot.P = params.N, params.R, params.P
+	key, err := scrypt.Key(password, salt, slot.N, slot.R, slot.P, aegisKeyLen)
+	return slot, key, err
+}
+
+// otpEntriesToAegis converts our internal vault representation back
+// into Aegis entries, preserving the HOTP counter/digit count and the
+// TOTP digit/period/algorithm so a decrypt-modify-encrypt round trip
+// doesn't rewind, truncate or reset codes that have already been
+// issued.
+func otpEntriesToAegis(entries []otpEntry) []aegisEntry {
+	out := make([]aegisEntry, 0, len(entries))
+	for _, e := range entries {
+		typ := e.Type
+		if typ == "" {
+			typ = "totp"
+		}
+		entry := aegisEntry{Type: typ, Name: e.Account, Issuer: e.Issuer}
+		entry.Info.Secret = e.secret
+		switch typ {
+		case "hotp":
+			entry.Info.Digits = e.digits
+			if entry.Info.Digits == 0 {
+				entry.Info.Digits = 6
+			}
+			// e.counter is the value already consumed to produce this
+			// entry's current Token; Info.Counter records the next,
+			// not-yet-used value, matching Aegis's own convention.
+			entry.Info.Counter = e.counter + 1
+		case "totp":
+			entry.Info.Digits = e.digits
+			if entry.Info.Digits == 0 {
+				entry.Info.Digits = 6
+			}
+			entry.Info.Period = e.period
+			if entry.Info.Period == 0 {
+				entry.Info.Period = 30
+			}
+			entry.Info.Algo = e.algo
+			if entry.Info.Algo == "" {
+				entry.Info.Algo = "SHA1"
+			}
+		}
+		out = append(out, entry)
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// Fixtures under testdata/aegis_<kdf>.json are fixed Aegis encrypted
+// exports, independent of this package's own AES-GCM/scrypt/Argon2id
+// code: they were sealed with OpenSSL's libcrypto (not Go's crypto/aes)
+// and, for the Argon2id fixture, reference libargon2 (not
+// golang.org/x/crypto/argon2). Both wrap a known master key around a
+// single "hunter2"-password slot and seal the same known plaintext DB,
+// so a matching bug in both aegisDecrypt's derivation and its own
+// verification wouldn't be hidden by round-tripping through itself.
+const fixturePassword = "hunter2"
+
+const fixturePlainDB = `{"version":2,"entries":[{"type":"totp","uuid":"fixture-uuid","name":"alice@example.com","issuer":"Example","icon":null,"info":{"secret":"JBSWY3DPEHPK3PXP","digits":6,"period":30,"algo":"SHA1"}}]}`
+
+func fixturePath(t *testing.T, kdf string) string {
+	t.Helper()
+	path := filepath.Join("testdata", "aegis_"+kdf+".json")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("fixture %s: %v", path, err)
+	}
+	return path
+}
+
+func TestAegisDecryptKDFs(t *testing.T) {
+	for _, kdf := range []string{"scrypt", "argon2id"} {
+		kdf := kdf
+		t.Run(kdf, func(t *testing.T) {
+			db, err := aegisDecrypt(fixturePath(t, kdf), []byte(fixturePassword))
+			if err != nil {
+				t.Fatalf("aegisDecrypt: %v", err)
+			}
+			if string(db) != fixturePlainDB {
+				t.Errorf("got %q, want %q", db, fixturePlainDB)
+			}
+
+			entries, err := filterAegisVault(db, regexp.MustCompile("."), t.TempDir()+"/hotp-counters.json")
+			if err != nil {
+				t.Fatalf("filterAegisVault: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if e.Issuer != "Example" || e.Account != "alice@example.com" || e.Type != "totp" {
+				t.Errorf("got %+v, want issuer=Example account=alice@example.com type=totp", e)
+			}
+		})
+	}
+}
+
+func TestAegisDecryptWrongPassword(t *testing.T) {
+	if _, err := aegisDecrypt(fixturePath(t, "scrypt"), []byte("wrong")); err == nil {
+		t.Fatal("expected an error decrypting with the wrong password")
+	}
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dialTimeout bounds how long we wait to connect to a (possibly stale)
+// agent socket before giving up and falling back to inline decryption.
+const dialTimeout = 500 * time.Millisecond
+
+// Client talks to a running agent over its Unix domain socket.
+type Client struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// SocketPath returns the path to the agent socket for the current user,
+// honoring $XDG_RUNTIME_DIR when set.
+func SocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "termotp.sock")
+}
+
+// Dial connects to the agent listening on socketPath. Callers should
+// treat any error as "no agent running" and fall back to inline
+// decryption.
+func Dial(socketPath string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", socketPath, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}, nil
+}
+
+// Close closes the connection to the agent.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) roundTrip(req Request) (Response, error) {
+	var resp Response
+
+	if err := json.NewEncoder(c.rw).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := c.rw.Flush(); err != nil {
+		return resp, err
+	}
+
+	line, err := c.rw.ReadString('\n')
+	if err != nil {
+		return resp, err
+	}
+	if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("agent: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// List returns every vault entry whose issuer or account matches the
+// regular expression match (an empty string matches everything).
+func (c *Client) List(match string) ([]Entry, error) {
+	resp, err := c.roundTrip(Request{Op: "list", Match: match})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// Lock asks the agent to immediately forget its master key.
+func (c *Client) Lock() error {
+	_, err := c.roundTrip(Request{Op: "lock"})
+	return err
+}
+
+// Status returns "locked" or "unlocked".
+func (c *Client) Status() (string, error) {
+	resp, err := c.roundTrip(Request{Op: "status"})
+	if err != nil {
+		return "", err
+	}
+	return resp.Status, nil
+}
@@ -0,0 +1,35 @@
+// This file is part of termOTP, a TOTP program for your terminal.
+// https://github.com/marcopaganini/termotp.
+//
+// Package agent implements a long-running background process that holds a
+// decrypted vault in memory and serves OTP queries over a Unix domain
+// socket, so callers don't have to re-enter the vault password for every
+// invocation. It mirrors the ssh-agent/gpg-agent model.
+package agent
+
+// Entry is the wire representation of a single vault entry returned by the
+// agent. It's intentionally independent from termotp's internal otpEntry
+// type, since this package must not import package main.
+type Entry struct {
+	Issuer  string `json:"issuer"`
+	Account string `json:"account"`
+	Token   string `json:"token"`
+	Type    string `json:"type,omitempty"`
+}
+
+// Request is a single line-delimited JSON request sent to the agent.
+type Request struct {
+	// Op is one of "list", "lock" or "status".
+	Op string `json:"op"`
+	// Match is a regular expression used by "list" to filter entries by
+	// issuer or account.
+	Match string `json:"match,omitempty"`
+}
+
+// Response is a single line-delimited JSON response sent back by the agent.
+type Response struct {
+	Entries []Entry `json:"entries,omitempty"`
+	// Status is set by the "status" op: "locked" or "unlocked".
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,177 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultAutoLock is the default inactivity period after which the agent
+// locks itself and forgets the master key.
+const DefaultAutoLock = 10 * time.Minute
+
+// Store answers "list" requests against the decrypted vault held in
+// memory. It's supplied by the caller (package main), which owns the
+// decrypted vault and the crypto material needed to recompute tokens.
+// Zero must actually discard that material (e.g. by dropping the
+// caller's only reference to the backing slice), since it's the only
+// thing standing between a locked agent and a process whose memory still
+// holds every secret: List is expected to fail once Zero has run.
+type Store interface {
+	List(match string) ([]Entry, error)
+	Zero()
+}
+
+// Server is a running termotp agent, listening on a Unix domain socket.
+type Server struct {
+	socketPath string
+	autoLock   time.Duration
+	store      Store
+
+	mu         sync.Mutex
+	locked     bool
+	lastActive time.Time
+}
+
+// NewServer creates an agent Server listening on socketPath. store answers
+// "list" requests and is zeroed when the server locks itself, either
+// via Lock or after autoLock of inactivity (zero selects DefaultAutoLock).
+func NewServer(socketPath string, autoLock time.Duration, store Store) *Server {
+	if autoLock == 0 {
+		autoLock = DefaultAutoLock
+	}
+	return &Server{
+		socketPath: socketPath,
+		autoLock:   autoLock,
+		store:      store,
+		lastActive: timeNow(),
+	}
+}
+
+// timeNow exists so tests can stub the clock if needed; production code
+// always uses time.Now.
+var timeNow = time.Now
+
+// Serve listens on the agent's socket and handles requests until the
+// listener is closed or an unrecoverable error occurs. It removes a
+// stale socket file left over from a previous run before listening.
+func (s *Server) Serve() error {
+	if err := os.RemoveAll(s.socketPath); err != nil {
+		return fmt.Errorf("agent: removing stale socket: %v", err)
+	}
+
+	ln, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return fmt.Errorf("agent: listen: %v", err)
+	}
+	defer ln.Close()
+
+	if err := os.Chmod(s.socketPath, 0600); err != nil {
+		return fmt.Errorf("agent: chmod socket: %v", err)
+	}
+
+	go s.autoLockLoop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		if err := checkPeer(conn); err != nil {
+			conn.Close()
+			continue
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// autoLockLoop periodically checks for inactivity and locks the agent
+// once autoLock has elapsed since the last request.
+func (s *Server) autoLockLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.mu.Lock()
+		idle := timeNow().Sub(s.lastActive)
+		if !s.locked && idle >= s.autoLock {
+			s.locked = true
+			s.store.Zero()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Lock locks the agent immediately, regardless of the auto-lock timer,
+// and has the store discard the secrets it holds.
+func (s *Server) Lock() {
+	s.mu.Lock()
+	s.locked = true
+	s.store.Zero()
+	s.mu.Unlock()
+}
+
+// touch marks the agent as active, resetting the auto-lock timer, and
+// returns whether the agent is currently locked.
+func (s *Server) touch() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.locked {
+		s.lastActive = timeNow()
+	}
+	return s.locked
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			enc.Encode(Response{Error: err.Error()})
+			continue
+		}
+		enc.Encode(s.handleRequest(req))
+	}
+}
+
+func (s *Server) handleRequest(req Request) Response {
+	if req.Op == "lock" {
+		s.Lock()
+		return Response{Status: "locked"}
+	}
+
+	locked := s.touch()
+
+	switch req.Op {
+	case "status":
+		status := "unlocked"
+		if locked {
+			status = "locked"
+		}
+		return Response{Status: status}
+	case "list":
+		if locked {
+			return Response{Error: "agent is locked"}
+		}
+		entries, err := s.store.List(req.Match)
+		if err != nil {
+			return Response{Error: err.Error()}
+		}
+		return Response{Entries: entries}
+	default:
+		return Response{Error: fmt.Sprintf("unknown op: %q", req.Op)}
+	}
+}
+
+// ErrUnsupported describes a peer credential check that can't be
+// performed on this platform. Nothing in this package returns it: on
+// such platforms checkPeer returns nil and every connection is accepted.
+var ErrUnsupported = errors.New("agent: peer credential check unsupported on this platform")
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// buildAndotpFixture assembles a minimal encrypted andOTP backup file:
+// salt(12) + iv(12) + AES-GCM sealed plainJSON, derived from password
+// with PBKDF2-HMAC-SHA1 at the given iteration count. If header is true,
+// the file is prefixed with iterations as a 4-byte big-endian count, the
+// way newer andOTP versions do; if false, it's omitted, as in legacy
+// backups. It returns the path to the file it wrote.
+func buildAndotpFixture(t *testing.T, dir, name, password string, iterations int, header bool, plainJSON []byte) string {
+	t.Helper()
+
+	salt := make([]byte, andotpSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, andotpIVLen)
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, iterations, aegisKeyLen, sha1.New)
+	aesgcm, err := newAES(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := aesgcm.Seal(nil, iv, plainJSON, nil)
+
+	var buf []byte
+	if header {
+		buf = make([]byte, 4)
+		binary.BigEndian.PutUint32(buf, uint32(iterations))
+	}
+	buf = append(buf, salt...)
+	buf = append(buf, iv...)
+	buf = append(buf, sealed...)
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAndotpDecryptNewFormat(t *testing.T) {
+	const password = "hunter2"
+	dir := t.TempDir()
+	want := []byte(`[{"secret":"JBSWY3DPEHPK3PXP","issuer":"Example","label":"alice","digits":6,"period":30,"algorithm":"SHA1","type":"TOTP"}]`)
+
+	path := buildAndotpFixture(t, dir, "new.andotp", password, 50000, true, want)
+
+	got, err := andotpDecrypt(path, []byte(password), false)
+	if err != nil {
+		t.Fatalf("andotpDecrypt: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAndotpDecryptLegacyFormat(t *testing.T) {
+	const password = "hunter2"
+	dir := t.TempDir()
+	want := []byte(`[{"secret":"JBSWY3DPEHPK3PXP","issuer":"Example","label":"alice","digits":6,"period":30,"algorithm":"SHA1","type":"TOTP"}]`)
+
+	path := buildAndotpFixture(t, dir, "legacy.andotp", password, andotpLegacyIterations, false, want)
+
+	got, err := andotpDecrypt(path, []byte(password), true)
+	if err != nil {
+		t.Fatalf("andotpDecrypt: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAndotpDecryptWrongPassword(t *testing.T) {
+	dir := t.TempDir()
+	path := buildAndotpFixture(t, dir, "wrong.andotp", "correct", andotpLegacyIterations, false, []byte(`[]`))
+
+	if _, err := andotpDecrypt(path, []byte("wrong"), true); err == nil {
+		t.Fatal("expected an error decrypting with the wrong password")
+	}
+}
+
+func TestFilterAndotpVault(t *testing.T) {
+	plainJSON := []byte(`[
+		{"secret":"JBSWY3DPEHPK3PXP","issuer":"Example","label":"alice","type":"TOTP"},
+		{"secret":"KRSXG5CTMVRXEZLU","issuer":"Other","label":"bob","type":""},
+		{"secret":"","issuer":"Unsupported","label":"carol","type":"HOTP"}
+	]`)
+
+	got, err := filterAndotpVault(plainJSON, regexp.MustCompile("."))
+	if err != nil {
+		t.Fatalf("filterAndotpVault: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3", len(got))
+	}
+	if got[0].Type != "totp" || got[0].Token == "" {
+		t.Errorf("entry 0: got %+v, want a totp entry with a computed token", got[0])
+	}
+	if got[2].Type != "hotp" || got[2].Token == "" {
+		t.Errorf("entry 2: got %+v, want an hotp entry flagged as unsupported", got[2])
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestAegisEncryptDecryptRoundTrip(t *testing.T) {
+	const password = "hunter2"
+
+	entries := []otpEntry{
+		{Issuer: "Example", Account: "alice@example.com", Type: "totp", secret: "JBSWY3DPEHPK3PXP"},
+		{Issuer: "Other", Account: "bob@example.com", Type: "totp", secret: "KRSXG5CTMVRXEZLU"},
+	}
+
+	buf, err := aegisEncrypt(entries, []byte(password), DefaultScryptParams())
+	if err != nil {
+		t.Fatalf("aegisEncrypt: %v", err)
+	}
+
+	path := writeTempFile(t, buf)
+
+	db, err := aegisDecrypt(path, []byte(password))
+	if err != nil {
+		t.Fatalf("aegisDecrypt: %v", err)
+	}
+
+	got, err := filterAegisVault(db, regexp.MustCompile("."), path+".hotp-counters.json")
+	if err != nil {
+		t.Fatalf("filterAegisVault: %v", err)
+	}
+
+	if len(got) != len(entries) {
+		t.Fatalf("got %d entries, want %d", len(got), len(entries))
+	}
+	for i, e := range entries {
+		if got[i].Issuer != e.Issuer || got[i].Account != e.Account {
+			t.Errorf("entry %d: got %+v, want issuer=%q account=%q", i, got[i], e.Issuer, e.Account)
+		}
+	}
+
+	if _, err := aegisDecrypt(path, []byte("wrong password")); err == nil {
+		t.Fatal("expected an error decrypting the round-tripped vault with the wrong password")
+	}
+}
+
+func TestAegisEncryptPreservesHOTPCounter(t *testing.T) {
+	const password = "hunter2"
+
+	entries := []otpEntry{
+		{Issuer: "Example", Account: "alice@example.com", Type: "hotp", secret: "JBSWY3DPEHPK3PXP", digits: 6, counter: 41},
+	}
+
+	buf, err := aegisEncrypt(entries, []byte(password), DefaultScryptParams())
+	if err != nil {
+		t.Fatalf("aegisEncrypt: %v", err)
+	}
+	path := writeTempFile(t, buf)
+
+	db, err := aegisDecrypt(path, []byte(password))
+	if err != nil {
+		t.Fatalf("aegisDecrypt: %v", err)
+	}
+
+	got, err := filterAegisVault(db, regexp.MustCompile("."), path+".hotp-counters.json")
+	if err != nil {
+		t.Fatalf("filterAegisVault: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d entries, want 1", len(got))
+	}
+
+	// The counter that comes back out must be the one exported (42, the
+	// value after the one already consumed), not reset to 0.
+	if got[0].counter != 42 {
+		t.Errorf("counter = %d, want 42 (the entry's counter survived the round trip)", got[0].counter)
+	}
+}
+
+func TestFilterAegisVaultSkipsNonMatchingHOTPCounter(t *testing.T) {
+	const password = "hunter2"
+	counterPath := filepath.Join(t.TempDir(), "hotp-counters.json")
+
+	entries := []otpEntry{
+		{Issuer: "Example", Account: "alice@example.com", Type: "hotp", secret: "JBSWY3DPEHPK3PXP", digits: 6, counter: 10},
+	}
+
+	buf, err := aegisEncrypt(entries, []byte(password), DefaultScryptParams())
+	if err != nil {
+		t.Fatalf("aegisEncrypt: %v", err)
+	}
+	path := writeTempFile(t, buf)
+
+	db, err := aegisDecrypt(path, []byte(password))
+	if err != nil {
+		t.Fatalf("aegisDecrypt: %v", err)
+	}
+
+	// A regexp that doesn't match the only entry in the vault must not
+	// advance its HOTP counter.
+	if _, err := filterAegisVault(db, regexp.MustCompile("nomatch"), counterPath); err != nil {
+		t.Fatalf("filterAegisVault: %v", err)
+	}
+
+	got, err := filterAegisVault(db, regexp.MustCompile("."), counterPath)
+	if err != nil {
+		t.Fatalf("filterAegisVault: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d entries, want 1", len(got))
+	}
+	// otpEntriesToAegis persists the next not-yet-used counter (11, one
+	// past the source entry's 10), so the first real match must consume
+	// exactly that value, not one already bumped by the earlier
+	// non-matching lookup.
+	if got[0].counter != 11 {
+		t.Errorf("counter = %d, want 11 (unchanged by the earlier non-matching lookup)", got[0].counter)
+	}
+}
+
+func TestAegisEncryptPreservesTOTPParams(t *testing.T) {
+	const password = "hunter2"
+
+	entries := []otpEntry{
+		{Issuer: "Example", Account: "alice@example.com", Type: "totp", secret: "JBSWY3DPEHPK3PXP", digits: 8, period: 60, algo: "SHA256"},
+	}
+
+	buf, err := aegisEncrypt(entries, []byte(password), DefaultScryptParams())
+	if err != nil {
+		t.Fatalf("aegisEncrypt: %v", err)
+	}
+	path := writeTempFile(t, buf)
+
+	db, err := aegisDecrypt(path, []byte(password))
+	if err != nil {
+		t.Fatalf("aegisDecrypt: %v", err)
+	}
+
+	got, err := filterAegisVault(db, regexp.MustCompile("."), path+".hotp-counters.json")
+	if err != nil {
+		t.Fatalf("filterAegisVault: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d entries, want 1", len(got))
+	}
+
+	// Non-default digits/period/algo must survive the round trip
+	// rather than being rewritten to Aegis's 6/30/SHA1 defaults.
+	if got[0].digits != 8 || got[0].period != 60 || got[0].algo != "SHA256" {
+		t.Errorf("got digits=%d period=%d algo=%q, want digits=8 period=60 algo=\"SHA256\"", got[0].digits, got[0].period, got[0].algo)
+	}
+}
+
+func writeTempFile(t *testing.T, data []byte) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "vault-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
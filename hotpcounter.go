@@ -0,0 +1,68 @@
+// This file is part of termOTP, a TOTP program for your terminal.
+// https://github.com/marcopaganini/termotp.
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// hotpCounters persists the next counter value for each HOTP entry we've
+// emitted a token for, keyed by hotpCounterKey, so successive invocations
+// don't reuse the same code.
+type hotpCounters map[string]int
+
+// hotpCounterKey builds the sidecar key for an HOTP entry.
+func hotpCounterKey(issuer, account, uuid string) string {
+	return issuer + "/" + account + "/" + uuid
+}
+
+// loadAndAdvanceHOTPCounter returns the counter to use for key in this
+// invocation, and persists that counter plus one under key back to path
+// so the next invocation
+// moves on to the next code. If key has never been seen before, initial
+// is used as the starting counter. path is created if it doesn't exist
+// yet. An exclusive flock on path guards concurrent termotp runs.
+func loadAndAdvanceHOTPCounter(path, key string, initial int) (int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if err := lockCounterFile(f); err != nil {
+		return 0, err
+	}
+	defer unlockCounterFile(f)
+
+	counters := hotpCounters{}
+	buf, err := io.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) > 0 {
+		if err := json.Unmarshal(buf, &counters); err != nil {
+			return 0, err
+		}
+	}
+
+	counter, ok := counters[key]
+	if !ok {
+		counter = initial
+	}
+	counters[key] = counter + 1
+
+	out, err := json.Marshal(counters)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := f.WriteAt(out, 0); err != nil {
+		return 0, err
+	}
+
+	return counter, nil
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+// This file is part of termOTP, a TOTP program for your terminal.
+// https://github.com/marcopaganini/termotp.
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockCounterFile takes an exclusive flock on f, guarding concurrent
+// termotp runs against each other.
+func lockCounterFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_EX)
+}
+
+// unlockCounterFile releases the lock taken by lockCounterFile.
+func unlockCounterFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
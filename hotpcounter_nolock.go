@@ -0,0 +1,19 @@
+//go:build windows
+
+// This file is part of termOTP, a TOTP program for your terminal.
+// https://github.com/marcopaganini/termotp.
+package main
+
+import "os"
+
+// lockCounterFile is a no-op on Windows, where we don't have an flock
+// equivalent wired up; concurrent termotp runs on the same counter
+// file are not guarded against in that case.
+func lockCounterFile(f *os.File) error {
+	return nil
+}
+
+// unlockCounterFile is a no-op on Windows, mirroring lockCounterFile.
+func unlockCounterFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAndAdvanceHOTPCounter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	key := hotpCounterKey("Issuer", "Account", "uuid-1")
+
+	first, err := loadAndAdvanceHOTPCounter(path, key, 5)
+	if err != nil {
+		t.Fatalf("loadAndAdvanceHOTPCounter: %v", err)
+	}
+	if first != 5 {
+		t.Errorf("first counter = %d, want 5 (the initial value)", first)
+	}
+
+	second, err := loadAndAdvanceHOTPCounter(path, key, 5)
+	if err != nil {
+		t.Fatalf("loadAndAdvanceHOTPCounter: %v", err)
+	}
+	if second != 6 {
+		t.Errorf("second counter = %d, want 6", second)
+	}
+
+	// A different key starts fresh from its own initial value.
+	other := hotpCounterKey("Issuer", "Other", "uuid-2")
+	third, err := loadAndAdvanceHOTPCounter(path, other, 0)
+	if err != nil {
+		t.Fatalf("loadAndAdvanceHOTPCounter: %v", err)
+	}
+	if third != 0 {
+		t.Errorf("counter for a new key = %d, want 0", third)
+	}
+}
@@ -14,11 +14,14 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/marcopaganini/termotp/agent"
 	"github.com/romana/rlog"
+	"github.com/xlzd/gotp"
 	"github.com/zalando/go-keyring"
 )
 
@@ -31,6 +34,61 @@ type otpEntry struct {
 	Issuer  string
 	Account string
 	Token   string
+	// Type is the OTP entry type ("totp", "hotp", "steam", ...), surfaced
+	// so downstream tools consuming --json output can distinguish them.
+	Type string `json:",omitempty"`
+	// secret holds the raw OTP secret, used to recompute fresh tokens
+	// when the entry is held in memory by the agent daemon. It's
+	// unexported so it never leaks into JSON output.
+	secret string
+	// digits is the code length for Type == "hotp" and Type == "totp".
+	// counter is only meaningful for Type == "hotp": it's the value
+	// resolved by filterAegisVault (via loadAndAdvanceHOTPCounter) for
+	// this entry.
+	// freshToken reuses it rather than advancing the sidecar counter
+	// again on every redraw, since HOTP codes are meant to change once
+	// per use, not once per second.
+	digits  int
+	counter int
+	// period and algo are only meaningful for Type == "totp": period is
+	// the code's validity window in seconds and algo is the HMAC hash
+	// ("SHA1", "SHA256" or "SHA512"). Aegis lets each entry override
+	// these independently of the usual 30s/SHA1 default, and they must
+	// survive a decrypt/re-encrypt round trip unchanged.
+	period int
+	algo   string
+}
+
+// freshToken recomputes e's token from its secret, honoring e.Type.
+// Entries without a secret (e.g. unsupported OTP types) just return
+// their existing Token.
+func (e otpEntry) freshToken() string {
+	if e.secret == "" {
+		return e.Token
+	}
+	switch e.Type {
+	case "hotp":
+		digits := e.digits
+		if digits == 0 {
+			digits = 6
+		}
+		return gotp.NewHOTP(e.secret, digits, nil).At(e.counter)
+	case "steam":
+		tok, err := steamToken(e.secret)
+		if err != nil {
+			return e.Token
+		}
+		return tok
+	default:
+		digits, period := e.digits, e.period
+		if digits == 0 {
+			digits = 6
+		}
+		if period == 0 {
+			period = 30
+		}
+		return gotp.NewTOTP(e.secret, digits, period, totpHasher(e.algo)).Now()
+	}
 }
 
 // Keyring constants. User is not your user.
@@ -41,14 +99,19 @@ const (
 
 // cmdLineFlags contains the command-line flags.
 type cmdLineFlags struct {
-	input      string
-	fuzzy      bool
-	fzf        bool
-	plain      bool
-	json       bool
-	setkeyring bool
-	usekeyring bool
-	version    bool
+	input         string
+	format        string
+	fuzzy         bool
+	fzf           bool
+	plain         bool
+	json          bool
+	live          bool
+	setkeyring    bool
+	changekeyring bool
+	clearkeyring  bool
+	usekeyring    bool
+	version       bool
+	daemon        bool
 }
 
 // die logs a message with rlog.Critical and exits with a return code.
@@ -165,18 +228,24 @@ func parseFlags() (cmdLineFlags, error) {
 	flags := cmdLineFlags{}
 
 	flag.StringVar(&flags.input, "input", "", "Input (encrypted) JSON file glob.")
+	flag.StringVar(&flags.format, "format", "", "Input vault format (aegis, andotp, andotp-legacy). Auto-detected if empty.")
 	flag.BoolVar(&flags.fuzzy, "fuzzy", false, "Use interactive fuzzy finder.")
 	flag.BoolVar(&flags.fzf, "fzf", false, "Use fzf (needs external binary in path).")
 	flag.BoolVar(&flags.json, "json", false, "Use JSON output.")
 	flag.BoolVar(&flags.plain, "plain", false, "Use plain output (disables fuzzy finder and tabular output.)")
+	flag.BoolVar(&flags.live, "live", false, "Use interactive live-refresh TUI.")
+	flag.BoolVar(&flags.live, "watch", false, "Alias for --live.")
 	flag.BoolVar(&flags.version, "version", false, "Show program version and exit.")
 	flag.BoolVar(&flags.setkeyring, "set-keyring", false, "Set the keyring password and exit.")
+	flag.BoolVar(&flags.changekeyring, "change-keyring", false, "Change the stored keyring password and exit.")
+	flag.BoolVar(&flags.clearkeyring, "clear-keyring", false, "Remove the stored keyring password and exit.")
 	flag.BoolVar(&flags.usekeyring, "use-keyring", false, "Use keyring stored password.")
+	flag.BoolVar(&flags.daemon, "daemon", false, "Run as a background agent serving OTP queries over a Unix socket.")
 
 	flag.Parse()
 
-	// --setkeyring requires nothing else.
-	if flags.setkeyring {
+	// --clear-keyring requires nothing else.
+	if flags.clearkeyring {
 		return flags, nil
 	}
 
@@ -190,9 +259,20 @@ func parseFlags() (cmdLineFlags, error) {
 		return cmdLineFlags{}, errors.New("please specify input file with --input")
 	}
 
+	// --set-keyring and --change-keyring need --input (checked above) to
+	// validate the new password, but nothing else.
+	if flags.setkeyring || flags.changekeyring {
+		return flags, nil
+	}
+
+	// --daemon requires nothing else (it ignores any matching regexp).
+	if flags.daemon {
+		return flags, nil
+	}
+
 	// Only one output format allowed.
 	n := 0
-	for _, v := range []bool{flags.fuzzy, flags.fzf, flags.json, flags.plain} {
+	for _, v := range []bool{flags.fuzzy, flags.fzf, flags.json, flags.plain, flags.live} {
 		if v {
 			n++
 		}
@@ -205,6 +285,12 @@ func parseFlags() (cmdLineFlags, error) {
 		return cmdLineFlags{}, errors.New("specify one or zero regular expressions to match")
 	}
 
+	switch flags.format {
+	case "", "aegis", "andotp", "andotp-legacy":
+	default:
+		return cmdLineFlags{}, fmt.Errorf("invalid --format %q: must be one of aegis, andotp, andotp-legacy", flags.format)
+	}
+
 	// FZF uses plain output, with modifications (no headers, no automerge)
 	if flags.fzf {
 		flags.plain = true
@@ -248,20 +334,154 @@ func fzf(table string) (string, error) {
 	return f[len(f)-1], nil
 }
 
-// setkeyring asks for a password and write it to the keyring.
-func setkeyring() error {
-	password, err := readPassword()
+// setkeyring asks for a password (with confirmation), checks that it
+// actually unlocks the vault at flags.input, and writes it to the
+// keyring.
+func setkeyring(flags cmdLineFlags) error {
+	password, err := readPasswordConfirmed()
 	if err != nil {
 		return err
 	}
 
-	if err = keyring.Set(keyRingService, keyRingUser, string(password)); err != nil {
+	input, err := inputFile(flags.input)
+	if err != nil {
+		return err
+	}
+	decryptor, err := newVaultDecryptor(flags.format, input, regexp.MustCompile("."))
+	if err != nil {
 		return err
 	}
-	return nil
+	if _, err := decryptor.Decrypt(input, password); err != nil {
+		return fmt.Errorf("that password doesn't unlock %s: %v", input, err)
+	}
+
+	return keyring.Set(keyRingService, keyRingUser, string(password))
+}
+
+// matchRegexp builds the case-insensitive match expression for arg,
+// matching everything when arg is empty.
+func matchRegexp(arg string) string {
+	if arg == "" {
+		return "."
+	}
+	return "(?i)" + arg
+}
+
+// agentVault queries a running termotp agent for the entries matching
+// match. It returns an error (and no entries) if no agent is reachable,
+// in which case the caller should fall back to inline decryption.
+func agentVault(match string) ([]otpEntry, error) {
+	client, err := agent.Dial(agent.SocketPath())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	entries, err := client.List(match)
+	if err != nil {
+		return nil, err
+	}
+
+	vault := make([]otpEntry, len(entries))
+	for i, e := range entries {
+		vault[i] = otpEntry{Issuer: e.Issuer, Account: e.Account, Token: e.Token, Type: e.Type}
+	}
+	return vault, nil
+}
+
+// memVaultStore implements agent.Store over an already-decrypted vault
+// held entirely in memory. Zero drops the server's only reference to
+// the backing slice (including every entry's secret) so a locked agent
+// can't be tricked into still answering queries, and so the secrets
+// become eligible for garbage collection instead of lingering for the
+// life of the process.
+type memVaultStore struct {
+	mu    sync.Mutex
+	vault []otpEntry
+}
+
+// List implements agent.Store.
+func (s *memVaultStore) List(match string) ([]agent.Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vault == nil {
+		return nil, errors.New("agent is locked")
+	}
+
+	rematch, err := regexp.Compile(matchRegexp(match))
+	if err != nil {
+		return nil, err
+	}
+	entries := []agent.Entry{}
+	for _, e := range s.vault {
+		if rematch.MatchString(e.Issuer) || rematch.MatchString(e.Account) {
+			entries = append(entries, agent.Entry{
+				Issuer:  e.Issuer,
+				Account: e.Account,
+				Token:   e.freshToken(),
+				Type:    e.Type,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// Zero implements agent.Store.
+func (s *memVaultStore) Zero() {
+	s.mu.Lock()
+	s.vault = nil
+	s.mu.Unlock()
+}
+
+// runAgent decrypts the vault at input once, then serves OTP queries
+// over a Unix domain socket until killed.
+func runAgent(flags cmdLineFlags, input string) {
+	var (
+		password []byte
+		secret   string
+		err      error
+	)
+	if flags.usekeyring {
+		secret, err = keyring.Get(keyRingService, keyRingUser)
+		password = []byte(secret)
+	} else {
+		password, err = readPassword()
+	}
+	if err != nil {
+		die(err)
+	}
+
+	decryptor, err := newVaultDecryptor(flags.format, input, regexp.MustCompile("."))
+	if err != nil {
+		die(err)
+	}
+	vault, err := decryptor.Decrypt(input, password)
+	if err != nil {
+		die(err)
+	}
+
+	socketPath := agent.SocketPath()
+	rlog.Infof("termotp agent listening on %s", socketPath)
+	srv := agent.NewServer(socketPath, 0, &memVaultStore{vault: vault})
+	if err := srv.Serve(); err != nil {
+		die(err)
+	}
 }
 
 func main() {
+	// Route "add" and "import" subcommands before the regular flag
+	// parsing below, since they use their own flag sets.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "add":
+			runAdd(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		}
+	}
+
 	// Usage prints the default usage for this program.
 	flag.Usage = func() {
 		_, program := filepath.Split(os.Args[0])
@@ -275,9 +495,17 @@ func main() {
 		die(err)
 	}
 
-	if flags.setkeyring {
+	if flags.clearkeyring {
+		if err := keyring.Delete(keyRingService, keyRingUser); err != nil {
+			die(err)
+		}
+		fmt.Println("Keyring password removed.")
+		os.Exit(0)
+	}
+
+	if flags.setkeyring || flags.changekeyring {
 		fmt.Println("Please enter the password to be stored in the keyring.")
-		if err := setkeyring(); err != nil {
+		if err := setkeyring(flags); err != nil {
 			die(err)
 		}
 		fmt.Println("Password set. Use --use-keyring to read the password from the keyring.")
@@ -291,43 +519,58 @@ func main() {
 	}
 	rlog.Debugf("Input file: %s", input)
 
+	if flags.daemon {
+		runAgent(flags, input)
+		return
+	}
+
 	// By default, match everything (.) unless overridden by an argument.
-	r := "."
+	matchArg := ""
 	if len(flag.Args()) > 0 {
-		r = "(?i)" + flag.Args()[0]
+		matchArg = flag.Args()[0]
 	}
-	rematch, err := regexp.Compile(r)
+	rematch, err := regexp.Compile(matchRegexp(matchArg))
 	if err != nil {
 		die(err)
 	}
 
-	// Read password (from keyboard or keyring) and decrypt aegis vault.
-	var (
-		password []byte
-		secret   string
-	)
-
-	if flags.usekeyring {
-		secret, err = keyring.Get(keyRingService, keyRingUser)
-		password = []byte(secret)
+	// If an agent is running, query it instead of decrypting inline. In
+	// that case, liveRefresh re-queries the agent for up-to-date tokens
+	// on every --live tick, since agent-held entries carry no secret
+	// for freshToken to recompute locally.
+	var liveRefresh func() ([]otpEntry, error)
+	vault, err := agentVault(matchArg)
+	if err == nil {
+		liveRefresh = func() ([]otpEntry, error) { return agentVault(matchArg) }
 	} else {
-		password, err = readPassword()
-	}
-	if err != nil {
-		die(err)
-	}
+		// Read password (from keyboard or keyring) and decrypt the vault.
+		var (
+			password []byte
+			secret   string
+		)
+
+		if flags.usekeyring {
+			secret, err = keyring.Get(keyRingService, keyRingUser)
+			password = []byte(secret)
+		} else {
+			password, err = readPassword()
+		}
+		if err != nil {
+			die(err)
+		}
 
-	db, err := aegisDecrypt(input, password)
-	if err != nil {
-		die(err)
-	}
-	rlog.Debugf("Decoded JSON:\n%s\n", string(db))
+		decryptor, err := newVaultDecryptor(flags.format, input, rematch)
+		if err != nil {
+			die(err)
+		}
 
-	// Filter and sort vault.
-	vault, err := filterAegisVault(db, rematch)
-	if err != nil {
-		die(err)
+		vault, err = decryptor.Decrypt(input, password)
+		if err != nil {
+			die(err)
+		}
 	}
+
+	// Sort vault.
 	if len(vault) == 0 {
 		rlog.Info("No matching entries found.")
 		os.Exit(1)
@@ -339,6 +582,10 @@ func main() {
 	})
 
 	switch {
+	case flags.live:
+		if err := liveTUI(vault, liveRefresh); err != nil {
+			die(err)
+		}
 	case flags.fuzzy:
 		// Interactive fuzzy finder.
 		if flags.fuzzy {
@@ -0,0 +1,57 @@
+// This file is part of termOTP, a TOTP program for your terminal.
+// https://github.com/marcopaganini/termotp.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// steamAlphabet is the 26-character alphabet Steam Guard uses to render
+// its 5-character tokens, instead of the usual decimal digits.
+const steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+
+// steamPeriod is Steam Guard's TOTP timestep, in seconds.
+const steamPeriod = 30
+
+// steamToken computes the current Steam Guard code for secret (a base32
+// encoded shared secret), the same way the Steam mobile app does.
+func steamToken(secret string) (string, error) {
+	return steamTokenAt(secret, time.Now().Unix())
+}
+
+// steamTokenAt computes the Steam Guard code for secret at unixTime.
+func steamTokenAt(secret string, unixTime int64) (string, error) {
+	secret = strings.ToUpper(secret)
+	if m := len(secret) % 8; m != 0 {
+		secret += strings.Repeat("=", 8-m)
+	}
+	key, err := base32.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(unixTime)/steamPeriod)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := uint32(sum[offset]&0x7f)<<24 |
+		uint32(sum[offset+1])<<16 |
+		uint32(sum[offset+2])<<8 |
+		uint32(sum[offset+3])
+
+	var b strings.Builder
+	for i := 0; i < 5; i++ {
+		b.WriteByte(steamAlphabet[code%uint32(len(steamAlphabet))])
+		code /= uint32(len(steamAlphabet))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestSteamTokenAt(t *testing.T) {
+	const (
+		secret = "NGUJZVSKRBGUURJU"
+		want   = "H7FM9"
+	)
+
+	tok, err := steamTokenAt(secret, 1469312356)
+	if err != nil {
+		t.Fatalf("steamTokenAt: %v", err)
+	}
+	if tok != want {
+		t.Errorf("steamTokenAt(%q, 1469312356) = %q, want %q", secret, tok, want)
+	}
+	for _, c := range tok {
+		if !contains(steamAlphabet, byte(c)) {
+			t.Errorf("token %q contains character %q outside the Steam alphabet", tok, c)
+		}
+	}
+
+	// Deterministic: same secret and time always produce the same code.
+	tok2, err := steamTokenAt(secret, 1469312356)
+	if err != nil {
+		t.Fatalf("steamTokenAt: %v", err)
+	}
+	if tok != tok2 {
+		t.Errorf("steamTokenAt is not deterministic: %q != %q", tok, tok2)
+	}
+}
+
+func contains(s string, b byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == b {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,331 @@
+// This file is part of termOTP, a TOTP program for your terminal.
+// https://github.com/marcopaganini/termotp.
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// liveRefreshInterval is how often the live TUI redraws.
+const liveRefreshInterval = time.Second
+
+// totpPeriod is the timestep (in seconds) used by gotp.NewDefaultTOTP.
+// It drives the live view's shared countdown bar and is the per-entry
+// period for TOTP entries that don't set their own (see entryPeriod).
+const totpPeriod = 30
+
+// liveTUI draws an interactive, auto-refreshing table of vault, with a
+// shared countdown bar, a per-entry remaining-seconds column, fuzzy
+// filtering ('/'), clipboard copy (Enter) and quit ('q' or Esc).
+//
+// refresh, if non-nil, is called on every tick to re-fetch up-to-date
+// tokens for vault's entries (matched by issuer/account) and replaces
+// the usual local freshToken recomputation. It must be used whenever
+// vault came from an agent: agent-backed entries carry no secret, so
+// freshToken can't recompute their tokens itself and would otherwise
+// just keep re-displaying the token from the initial query.
+func liveTUI(vault []otpEntry, refresh func() ([]otpEntry, error)) error {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err := screen.Init(); err != nil {
+		return err
+	}
+	defer screen.Fini()
+
+	events := make(chan tcell.Event, 8)
+	go screen.ChannelEvents(events, nil)
+
+	ticker := time.NewTicker(liveRefreshInterval)
+	defer ticker.Stop()
+
+	var (
+		filter     string
+		filtering  bool
+		cursor     int
+		copiedMsg  string
+		copiedTill time.Time
+		frame      liveFrame
+	)
+
+	draw := func() {
+		filtered := filterEntries(vault, filter)
+		if cursor >= len(filtered) {
+			cursor = len(filtered) - 1
+		}
+		if cursor < 0 {
+			cursor = 0
+		}
+		renderLiveTable(screen, &frame, filtered, cursor, filter, filtering, copiedMsg)
+	}
+
+	draw()
+
+	for {
+		select {
+		case <-ticker.C:
+			if time.Now().After(copiedTill) {
+				copiedMsg = ""
+			}
+			if refresh != nil {
+				if fresh, err := refresh(); err != nil {
+					copiedMsg = fmt.Sprintf("refresh failed: %v", err)
+				} else {
+					updateTokens(vault, fresh)
+				}
+			} else {
+				for i := range vault {
+					vault[i].Token = vault[i].freshToken()
+				}
+			}
+			draw()
+
+		case ev := <-events:
+			switch ev := ev.(type) {
+			case *tcell.EventResize:
+				screen.Sync()
+				draw()
+
+			case *tcell.EventKey:
+				filtered := filterEntries(vault, filter)
+
+				if filtering {
+					switch ev.Key() {
+					case tcell.KeyEnter, tcell.KeyEscape:
+						filtering = false
+					case tcell.KeyBackspace, tcell.KeyBackspace2:
+						if len(filter) > 0 {
+							filter = filter[:len(filter)-1]
+						}
+					case tcell.KeyRune:
+						filter += string(ev.Rune())
+					}
+					cursor = 0
+					draw()
+					continue
+				}
+
+				switch {
+				case ev.Key() == tcell.KeyEscape || ev.Rune() == 'q':
+					return nil
+				case ev.Rune() == '/':
+					filtering = true
+				case ev.Key() == tcell.KeyDown || ev.Rune() == 'j':
+					if cursor < len(filtered)-1 {
+						cursor++
+					}
+				case ev.Key() == tcell.KeyUp || ev.Rune() == 'k':
+					if cursor > 0 {
+						cursor--
+					}
+				case ev.Key() == tcell.KeyEnter:
+					if cursor < len(filtered) {
+						if err := copyToClipboard(filtered[cursor].Token); err != nil {
+							copiedMsg = fmt.Sprintf("copy failed: %v", err)
+						} else {
+							copiedMsg = fmt.Sprintf("copied token for %s/%s", filtered[cursor].Issuer, filtered[cursor].Account)
+						}
+						copiedTill = time.Now().Add(3 * time.Second)
+					}
+				}
+				draw()
+			}
+		}
+	}
+}
+
+// updateTokens copies each entry's Token from fresh onto the matching
+// entry in vault (matched by issuer/account), leaving vault's order,
+// cursor position and any other fields untouched.
+func updateTokens(vault []otpEntry, fresh []otpEntry) {
+	tokens := make(map[string]string, len(fresh))
+	for _, e := range fresh {
+		tokens[e.Issuer+"/"+e.Account] = e.Token
+	}
+	for i := range vault {
+		if tok, ok := tokens[vault[i].Issuer+"/"+vault[i].Account]; ok {
+			vault[i].Token = tok
+		}
+	}
+}
+
+// filterEntries returns the entries of vault whose issuer or account
+// match the (case-insensitive) substring filter. An empty filter matches
+// everything.
+func filterEntries(vault []otpEntry, filter string) []otpEntry {
+	if filter == "" {
+		return vault
+	}
+	rematch, err := regexp.Compile("(?i)" + regexp.QuoteMeta(filter))
+	if err != nil {
+		return nil
+	}
+	var out []otpEntry
+	for _, e := range vault {
+		if rematch.MatchString(e.Issuer) || rematch.MatchString(e.Account) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// entryPeriod returns the timestep (in seconds) e's token refreshes on,
+// for the per-entry countdown column. HOTP codes only change when
+// consumed rather than on a timer, so they have no period.
+func entryPeriod(e otpEntry) int {
+	switch e.Type {
+	case "hotp":
+		return 0
+	case "steam":
+		return steamPeriod
+	default:
+		if e.period != 0 {
+			return e.period
+		}
+		return totpPeriod
+	}
+}
+
+// renderLiveTable draws the filtered vault as a table, with a shared
+// countdown bar showing the seconds remaining in the default TOTP
+// timestep plus a per-entry column with each entry's own remaining
+// seconds (" --" for HOTP entries), touching only the screen cells that changed since the last call
+// (see liveFrame).
+func renderLiveTable(screen tcell.Screen, frame *liveFrame, vault []otpEntry, cursor int, filter string, filtering bool, footer string) {
+	normal := tcell.StyleDefault
+	selected := tcell.StyleDefault.Reverse(true)
+	dim := tcell.StyleDefault.Dim(true)
+
+	remaining := totpPeriod - int(time.Now().Unix()%totpPeriod)
+	bar := fmt.Sprintf("Next refresh in %2ds  ", remaining)
+	frame.draw(screen, 0, normal, bar+strings.Repeat("#", remaining))
+
+	maxIssuer, maxAccount := 0, 0
+	for _, e := range vault {
+		if len(e.Issuer) > maxIssuer {
+			maxIssuer = len(e.Issuer)
+		}
+		if len(e.Account) > maxAccount {
+			maxAccount = len(e.Account)
+		}
+	}
+
+	for i, e := range vault {
+		style := normal
+		if i == cursor {
+			style = selected
+		}
+		countdown := " --"
+		if period := entryPeriod(e); period > 0 {
+			countdown = fmt.Sprintf("%3ds", period-int(time.Now().Unix()%int64(period)))
+		}
+		row := fmt.Sprintf("%-*s  %-*s  %-8s  %s", maxIssuer, e.Issuer, maxAccount, e.Account, e.Token, countdown)
+		frame.draw(screen, i+2, style, row)
+	}
+
+	prompt := "Press / to filter, Enter to copy, q to quit."
+	if filtering {
+		prompt = "Filter: " + filter
+	} else if filter != "" {
+		prompt = fmt.Sprintf("Filter: %s (press / to edit)", filter)
+	}
+	frame.draw(screen, len(vault)+3, dim, prompt)
+	lastLine := len(vault) + 3
+	if footer != "" {
+		frame.draw(screen, len(vault)+4, dim, footer)
+		lastLine = len(vault) + 4
+	}
+	frame.truncate(screen, lastLine+1)
+
+	screen.Show()
+}
+
+// liveFrame remembers what's currently drawn on each line of the live
+// TUI, so redraws only touch cells whose rune or style actually
+// changed instead of clearing and repainting the whole screen every
+// tick.
+type liveFrame struct {
+	lines []frameLine
+}
+
+// frameLine is the text and style last drawn on a given line.
+type frameLine struct {
+	text  string
+	style tcell.Style
+}
+
+// draw renders s at the start of line y in style, writing only the
+// cells whose rune or style differ from what was there before.
+func (f *liveFrame) draw(screen tcell.Screen, y int, style tcell.Style, s string) {
+	for len(f.lines) <= y {
+		f.lines = append(f.lines, frameLine{})
+	}
+	old := f.lines[y]
+	oldRunes := []rune(old.text)
+	newRunes := []rune(s)
+
+	n := len(oldRunes)
+	if len(newRunes) > n {
+		n = len(newRunes)
+	}
+	for x := 0; x < n; x++ {
+		oldR, newR := rune(' '), rune(' ')
+		if x < len(oldRunes) {
+			oldR = oldRunes[x]
+		}
+		if x < len(newRunes) {
+			newR = newRunes[x]
+		}
+		if oldR != newR || old.style != style {
+			screen.SetContent(x, y, newR, nil, style)
+		}
+	}
+	f.lines[y] = frameLine{text: s, style: style}
+}
+
+// truncate blanks every line from y onward that still holds content
+// from a previous, longer render (e.g. a filter that now matches
+// fewer entries), so stale rows don't linger on screen.
+func (f *liveFrame) truncate(screen tcell.Screen, y int) {
+	for ; y < len(f.lines); y++ {
+		if f.lines[y].text != "" {
+			f.draw(screen, y, tcell.StyleDefault, "")
+		}
+	}
+}
+
+// copyToClipboard copies s to the system clipboard, shelling out to
+// whichever supported clipboard tool is available. It returns an error
+// if none could be found.
+func copyToClipboard(s string) error {
+	candidates := [][]string{
+		{"pbcopy"},
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	}
+	for _, args := range candidates {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		fmt.Fprint(stdin, s)
+		stdin.Close()
+		return cmd.Wait()
+	}
+	return fmt.Errorf("no clipboard tool found (tried pbcopy, wl-copy, xclip, xsel)")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestEntryPeriod(t *testing.T) {
+	cases := []struct {
+		name string
+		e    otpEntry
+		want int
+	}{
+		{"totp default", otpEntry{Type: "totp"}, totpPeriod},
+		{"totp custom", otpEntry{Type: "totp", period: 60}, 60},
+		{"steam", otpEntry{Type: "steam"}, steamPeriod},
+		{"hotp has no timer", otpEntry{Type: "hotp"}, 0},
+	}
+	for _, c := range cases {
+		if got := entryPeriod(c.e); got != c.want {
+			t.Errorf("%s: entryPeriod() = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestUpdateTokens(t *testing.T) {
+	vault := []otpEntry{
+		{Issuer: "Example", Account: "alice@example.com", Token: "111111"},
+		{Issuer: "Other", Account: "bob@example.com", Token: "222222"},
+	}
+	fresh := []otpEntry{
+		{Issuer: "Example", Account: "alice@example.com", Token: "999999"},
+	}
+
+	updateTokens(vault, fresh)
+
+	if vault[0].Token != "999999" {
+		t.Errorf("vault[0].Token = %q, want %q (refreshed from the matching fresh entry)", vault[0].Token, "999999")
+	}
+	if vault[1].Token != "222222" {
+		t.Errorf("vault[1].Token = %q, want %q (left alone: no matching fresh entry)", vault[1].Token, "222222")
+	}
+}
+
+func TestLiveFrameDrawOnlyTouchesChangedCells(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("screen.Init: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(20, 5)
+
+	var frame liveFrame
+	frame.draw(screen, 0, tcell.StyleDefault, "token: 123456")
+
+	// Mark cell 0 behind the frame's back: if the next draw rewrote it,
+	// the marker would be replaced by 't' again.
+	screen.SetContent(0, 0, 'X', nil, tcell.StyleDefault)
+
+	// Only the digit that actually changed should be rewritten; the
+	// rest of the line must be left alone.
+	frame.draw(screen, 0, tcell.StyleDefault, "token: 123457")
+
+	mainc, _, _, _ := screen.GetContent(12, 0)
+	if mainc != '7' {
+		t.Errorf("cell 12 = %q, want '7'", mainc)
+	}
+	mainc, _, _, _ = screen.GetContent(0, 0)
+	if mainc != 'X' {
+		t.Errorf("cell 0 = %q, want 'X' (unchanged prefix should be untouched)", mainc)
+	}
+}
+
+func TestLiveFrameTruncateBlanksStaleLines(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("screen.Init: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(20, 5)
+
+	var frame liveFrame
+	frame.draw(screen, 2, tcell.StyleDefault, "stale row")
+	frame.truncate(screen, 2)
+
+	mainc, _, _, _ := screen.GetContent(0, 2)
+	if mainc != ' ' {
+		t.Errorf("cell (0,2) = %q, want blank after truncate", mainc)
+	}
+}
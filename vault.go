@@ -0,0 +1,75 @@
+// This file is part of termOTP, a TOTP program for your terminal.
+// https://github.com/marcopaganini/termotp.
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// VaultDecryptor decrypts a vault file and returns the entries matching
+// rematch. Each supported backup format (Aegis, andOTP, ...) implements
+// this interface.
+type VaultDecryptor interface {
+	Decrypt(path string, password []byte) ([]otpEntry, error)
+}
+
+// aegisVaultDecryptor implements VaultDecryptor for Aegis JSON exports.
+type aegisVaultDecryptor struct {
+	rematch *regexp.Regexp
+}
+
+// Decrypt implements VaultDecryptor.
+func (d aegisVaultDecryptor) Decrypt(path string, password []byte) ([]otpEntry, error) {
+	db, err := aegisDecrypt(path, password)
+	if err != nil {
+		return nil, err
+	}
+	return filterAegisVault(db, d.rematch, path+".hotp-counters.json")
+}
+
+// andotpVaultDecryptor implements VaultDecryptor for andOTP backups.
+// legacy forces the pre-header PBKDF2 iteration count, for callers who
+// know their backup predates andOTP's 4-byte iteration count header and
+// don't want to rely on andotpDecrypt's heuristic for telling the two
+// apart.
+type andotpVaultDecryptor struct {
+	rematch *regexp.Regexp
+	legacy  bool
+}
+
+// Decrypt implements VaultDecryptor.
+func (d andotpVaultDecryptor) Decrypt(path string, password []byte) ([]otpEntry, error) {
+	db, err := andotpDecrypt(path, password, d.legacy)
+	if err != nil {
+		return nil, err
+	}
+	return filterAndotpVault(db, d.rematch)
+}
+
+// newVaultDecryptor returns the VaultDecryptor for format ("aegis",
+// "andotp" or "andotp-legacy"). If format is empty, it auto-detects the
+// format by peeking at the contents of path.
+func newVaultDecryptor(format, path string, rematch *regexp.Regexp) (VaultDecryptor, error) {
+	if format == "" {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		format = "aegis"
+		if isAndotpFile(buf) {
+			format = "andotp"
+		}
+	}
+
+	switch format {
+	case "aegis":
+		return aegisVaultDecryptor{rematch: rematch}, nil
+	case "andotp":
+		return andotpVaultDecryptor{rematch: rematch}, nil
+	case "andotp-legacy":
+		return andotpVaultDecryptor{rematch: rematch, legacy: true}, nil
+	}
+	return nil, fmt.Errorf("unknown vault format: %q", format)
+}
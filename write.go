@@ -0,0 +1,140 @@
+// This file is part of termOTP, a TOTP program for your terminal.
+// https://github.com/marcopaganini/termotp.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/romana/rlog"
+	"github.com/zalando/go-keyring"
+)
+
+// writeAtomic writes data to path atomically: it writes to a temporary
+// file in the same directory, then renames it over path, preserving
+// path's mode if it already exists.
+func writeAtomic(path string, data []byte) error {
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode()
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// passwordForSubcommand reads the vault password from the keyring or the
+// terminal, the same way the main command line does.
+func passwordForSubcommand(usekeyring bool) ([]byte, error) {
+	if usekeyring {
+		secret, err := keyring.Get(keyRingService, keyRingUser)
+		return []byte(secret), err
+	}
+	return readPassword()
+}
+
+// runAdd implements "termotp add", which decrypts an Aegis vault, appends
+// a new TOTP entry to it and re-encrypts it in place.
+func runAdd(args []string) {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	input := fs.String("input", "", "Vault (Aegis) JSON file to modify.")
+	issuer := fs.String("issuer", "", "Issuer name for the new entry.")
+	account := fs.String("account", "", "Account name for the new entry.")
+	secret := fs.String("secret", "", "Base32 OTP secret for the new entry.")
+	usekeyring := fs.Bool("use-keyring", false, "Use keyring stored password.")
+	fs.Parse(args)
+
+	if *input == "" || *issuer == "" || *account == "" || *secret == "" {
+		die(errors.New("add: --input, --issuer, --account and --secret are all required"))
+	}
+
+	password, err := passwordForSubcommand(*usekeyring)
+	if err != nil {
+		die(err)
+	}
+
+	decryptor, err := newVaultDecryptor("aegis", *input, regexp.MustCompile("."))
+	if err != nil {
+		die(err)
+	}
+	vault, err := decryptor.Decrypt(*input, password)
+	if err != nil {
+		die(err)
+	}
+
+	vault = append(vault, otpEntry{Issuer: *issuer, Account: *account, Type: "totp", secret: *secret})
+
+	buf, err := aegisEncrypt(vault, password, DefaultScryptParams())
+	if err != nil {
+		die(err)
+	}
+	if err := writeAtomic(*input, buf); err != nil {
+		die(err)
+	}
+	rlog.Infof("Added %s/%s to %s", *issuer, *account, *input)
+}
+
+// runImport implements "termotp import", which decrypts entries from a
+// backup in another format and merges them into an Aegis vault. The
+// source backup and the destination vault are independently encrypted
+// files, so each gets its own password: the destination's can come from
+// the keyring (it's the one --use-keyring and --set-keyring are about),
+// but the source's is always read from the terminal.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	input := fs.String("input", "", "Destination vault (Aegis) JSON file.")
+	from := fs.String("from", "andotp", "Source backup format.")
+	usekeyring := fs.Bool("use-keyring", false, "Use keyring stored password for the destination vault.")
+	fs.Parse(args)
+
+	if *input == "" || fs.NArg() != 1 {
+		die(errors.New("import: usage: termotp import --input vault.json --from FORMAT source-file"))
+	}
+	source := fs.Arg(0)
+
+	dstPassword, err := passwordForSubcommand(*usekeyring)
+	if err != nil {
+		die(err)
+	}
+
+	fmt.Printf("Enter the password for the source backup (%s):\n", source)
+	srcPassword, err := readPassword()
+	if err != nil {
+		die(err)
+	}
+
+	srcDecryptor, err := newVaultDecryptor(*from, source, regexp.MustCompile("."))
+	if err != nil {
+		die(err)
+	}
+	srcEntries, err := srcDecryptor.Decrypt(source, srcPassword)
+	if err != nil {
+		die(err)
+	}
+
+	dstDecryptor, err := newVaultDecryptor("aegis", *input, regexp.MustCompile("."))
+	if err != nil {
+		die(err)
+	}
+	dstEntries, err := dstDecryptor.Decrypt(*input, dstPassword)
+	if err != nil {
+		die(err)
+	}
+
+	merged := append(dstEntries, srcEntries...)
+
+	buf, err := aegisEncrypt(merged, dstPassword, DefaultScryptParams())
+	if err != nil {
+		die(err)
+	}
+	if err := writeAtomic(*input, buf); err != nil {
+		die(err)
+	}
+	rlog.Infof("Imported %d entries from %s into %s", len(srcEntries), source, *input)
+}